@@ -0,0 +1,33 @@
+package statics
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+)
+
+// encodingSuffixes maps a Content-Encoding algorithm to the short suffix
+// appended to its ETag, so that cached variants of the same file don't
+// collide with each other across encodings.
+var encodingSuffixes = map[string]string{
+	"gzip": "gz",
+}
+
+// computeETag derives a strong ETag from the content of a file.
+func computeETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+}
+
+// encodingETag returns the ETag for a given Content-Encoding variant of a
+// file, derived from its uncompressed ETag.
+func encodingETag(etag string, algorithm string) string {
+	if algorithm == "" {
+		return etag
+	}
+	suffix, ok := encodingSuffixes[algorithm]
+	if !ok {
+		suffix = algorithm
+	}
+	return strings.TrimSuffix(etag, `"`) + "-" + suffix + `"`
+}
@@ -0,0 +1,72 @@
+package statics
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// AssetInfo describes a single asset served by a Handler, as returned by
+// Manifest. It carries everything a templating layer needs to reference
+// the asset without a separate build step, e.g. an <script integrity="…">
+// tag.
+type AssetInfo struct {
+	Path        string            `json:"path"`
+	Size        int64             `json:"size"`
+	ContentType string            `json:"contentType"`
+	ModTime     time.Time         `json:"modTime"`
+	SRI         map[string]string `json:"sri,omitempty"`
+	Encodings   []string          `json:"encodings,omitempty"`
+}
+
+// Handler is the http.Handler returned by FileServer and FileServerFS. In
+// addition to serving requests, it exposes the asset manifest built while
+// walking the filesystem.
+type Handler struct {
+	http.Handler
+	manifest map[string]AssetInfo
+}
+
+// Manifest returns a copy of the asset manifest, keyed by URL path.
+// Mutating the result does not affect the Handler.
+func (h *Handler) Manifest() map[string]AssetInfo {
+	manifest := make(map[string]AssetInfo, len(h.manifest))
+	for upath, info := range h.manifest {
+		sri := make(map[string]string, len(info.SRI))
+		for algorithm, hash := range info.SRI {
+			sri[algorithm] = hash
+		}
+		info.SRI = sri
+		info.Encodings = append([]string(nil), info.Encodings...)
+		manifest[upath] = info
+	}
+	return manifest
+}
+
+// sriHash computes a Subresource Integrity digest for body using algorithm
+// ("sha256" or "sha384"), formatted as "<algorithm>-<base64 digest>".
+func sriHash(algorithm string, body []byte) string {
+	var sum []byte
+	switch algorithm {
+	case "sha256":
+		s := sha256.Sum256(body)
+		sum = s[:]
+	case "sha384":
+		s := sha512.Sum384(body)
+		sum = s[:]
+	default:
+		return ""
+	}
+	return algorithm + "-" + base64.StdEncoding.EncodeToString(sum)
+}
+
+func manifestHandler(manifest map[string]AssetInfo) http.HandlerFunc {
+	body, _ := json.Marshal(manifest)
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}
+}
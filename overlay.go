@@ -0,0 +1,120 @@
+package statics
+
+import (
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"time"
+)
+
+// OverlayFS combines several fs.FS layers into one, resolving each path
+// against them in order: the first layer that has a regular file wins, and
+// directories are merged across all layers. This lets FileServerFS serve
+// from several sources at once, e.g. a user override directory shadowing
+// embedded defaults:
+//
+//	statics.FileServerFS(statics.OverlayFS(os.DirFS("./override"), embeddedFS))
+func OverlayFS(layers ...fs.FS) fs.FS {
+	return overlayFS(layers)
+}
+
+type overlayFS []fs.FS
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	var firstErr error
+	entries := map[string]fs.DirEntry{}
+	isDir := false
+
+	for _, layer := range o {
+		f, err := layer.Open(name)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		if !fi.IsDir() {
+			return f, nil
+		}
+
+		isDir = true
+		if rd, ok := f.(fs.ReadDirFile); ok {
+			if des, err := rd.ReadDir(-1); err == nil {
+				for _, de := range des {
+					if _, ok := entries[de.Name()]; !ok {
+						entries[de.Name()] = de
+					}
+				}
+			}
+		}
+		f.Close()
+	}
+
+	if isDir {
+		list := make([]fs.DirEntry, 0, len(entries))
+		for _, de := range entries {
+			list = append(list, de)
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+		return &overlayDir{name: name, entries: list}, nil
+	}
+
+	if firstErr == nil {
+		firstErr = fs.ErrNotExist
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: firstErr}
+}
+
+// overlayDir is the merged view of a directory that exists in more than one
+// overlay layer.
+type overlayDir struct {
+	name    string
+	entries []fs.DirEntry
+	read    int
+}
+
+func (d *overlayDir) Stat() (fs.FileInfo, error) { return overlayDirInfo{name: d.name}, nil }
+func (d *overlayDir) Read([]byte) (int, error)   { return 0, fs.ErrInvalid }
+func (d *overlayDir) Close() error               { return nil }
+
+func (d *overlayDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		entries := d.entries[d.read:]
+		d.read = len(d.entries)
+		return entries, nil
+	}
+
+	if d.read >= len(d.entries) {
+		return nil, io.EOF
+	}
+
+	end := d.read + n
+	if end > len(d.entries) {
+		end = len(d.entries)
+	}
+	entries := d.entries[d.read:end]
+	d.read = end
+	return entries, nil
+}
+
+type overlayDirInfo struct {
+	name string
+}
+
+func (i overlayDirInfo) Name() string       { return path.Base(i.name) }
+func (i overlayDirInfo) Size() int64        { return 0 }
+func (i overlayDirInfo) Mode() fs.FileMode  { return fs.ModeDir }
+func (i overlayDirInfo) ModTime() time.Time { return time.Time{} }
+func (i overlayDirInfo) IsDir() bool        { return true }
+func (i overlayDirInfo) Sys() any           { return nil }
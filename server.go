@@ -6,13 +6,16 @@ import (
 	"compress/zlib"
 	"io"
 	"io/fs"
+	"math"
 	"mime"
 	"net/http"
 	"os"
 	"path"
-	"path/filepath"
 	"sort"
 	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
 )
 
 type Option func(*option)
@@ -36,13 +39,151 @@ func WithNotFound(handler http.Handler) Option {
 	}
 }
 
+// WithCompressionAlgorithms sets the set of algorithms used to precompress
+// eligible assets at startup. Supported values are "gzip", "deflate", "br"
+// and "zstd". Defaults to all four.
+func WithCompressionAlgorithms(algorithms []string) Option {
+	return func(option *option) {
+		option.compressionAlgorithms = algorithms
+	}
+}
+
+// WithCompressionLevel overrides the compression level used for a single
+// algorithm. Accepted ranges follow the underlying implementation:
+// gzip/deflate 1-9, br 0-11, zstd 1-4 (see zstd.EncoderLevel). Levels
+// outside the algorithm's range are clamped to it.
+func WithCompressionLevel(algorithm string, level int) Option {
+	return func(option *option) {
+		option.compressionLevels[algorithm] = clampCompressionLevel(algorithm, level)
+	}
+}
+
+// WithPrecompressedExtensions declares sidecar files that hold an
+// already-compressed copy of their primary file, keyed by file extension
+// and mapped to the Content-Encoding they represent (e.g. ".gz" -> "gzip").
+// When present, the sidecar is served as-is instead of compressing the
+// primary file for that algorithm at startup, and the sidecar itself is not
+// registered as its own route. A sidecar that the primary does not use (the
+// primary is not compression-eligible, or the sidecar's algorithm is not in
+// WithCompressionAlgorithms) is instead served at its own path, with its
+// Content-Encoding set.
+func WithPrecompressedExtensions(extensions map[string]string) Option {
+	return func(option *option) {
+		option.precompressedExtensions = extensions
+	}
+}
+
+// WithManifestEndpoint serves the asset manifest (see Handler.Manifest) as
+// JSON at the given URL path.
+func WithManifestEndpoint(path string) Option {
+	return func(option *option) {
+		option.manifestEndpoint = path
+	}
+}
+
 type option struct {
 	compressibleContentTypes  []string
 	compressibleContentLength int
+	compressionAlgorithms     []string
+	compressionLevels         map[string]int
+	precompressedExtensions   map[string]string
+	manifestEndpoint          string
 	notFound                  http.Handler
 }
 
-func FileServer(dir string, options ...Option) http.Handler {
+func defaultCompressionLevel(algorithm string) int {
+	switch algorithm {
+	case "gzip":
+		return gzip.BestCompression
+	case "deflate":
+		return zlib.BestCompression
+	case "br":
+		return brotli.BestCompression
+	case "zstd":
+		return int(zstd.SpeedBestCompression)
+	default:
+		return 0
+	}
+}
+
+// compressionLevelRange returns the valid [min, max] level range accepted
+// by the given algorithm's writer constructor.
+func compressionLevelRange(algorithm string) (min, max int) {
+	switch algorithm {
+	case "gzip":
+		return gzip.BestSpeed, gzip.BestCompression
+	case "deflate":
+		return zlib.BestSpeed, zlib.BestCompression
+	case "br":
+		return brotli.BestSpeed, brotli.BestCompression
+	case "zstd":
+		return int(zstd.SpeedFastest), int(zstd.SpeedBestCompression)
+	default:
+		return math.MinInt32, math.MaxInt32
+	}
+}
+
+func clampCompressionLevel(algorithm string, level int) int {
+	min, max := compressionLevelRange(algorithm)
+	switch {
+	case level < min:
+		return min
+	case level > max:
+		return max
+	default:
+		return level
+	}
+}
+
+// compress encodes body with the given algorithm and level. ok is false for
+// an unsupported algorithm, or if the underlying writer rejects the level,
+// so the caller never publishes an encoding whose payload isn't actually
+// in that encoding.
+func compress(algorithm string, level int, body []byte) (data []byte, ok bool) {
+	buf := bytes.NewBuffer(nil)
+	switch algorithm {
+	case "gzip":
+		w, err := gzip.NewWriterLevel(buf, level)
+		if err != nil {
+			return nil, false
+		}
+		io.Copy(w, bytes.NewReader(body))
+		w.Close()
+	case "deflate":
+		w, err := zlib.NewWriterLevel(buf, level)
+		if err != nil {
+			return nil, false
+		}
+		io.Copy(w, bytes.NewReader(body))
+		w.Close()
+	case "br":
+		w := brotli.NewWriterLevel(buf, level)
+		io.Copy(w, bytes.NewReader(body))
+		w.Close()
+	case "zstd":
+		w, err := zstd.NewWriter(buf, zstd.WithEncoderLevel(zstd.EncoderLevel(level)))
+		if err != nil {
+			return nil, false
+		}
+		io.Copy(w, bytes.NewReader(body))
+		w.Close()
+	default:
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
+
+// FileServer returns a Handler that serves the files under dir, as
+// FileServerFS does for an os.DirFS(dir).
+func FileServer(dir string, options ...Option) *Handler {
+	return FileServerFS(os.DirFS(dir), options...)
+}
+
+// FileServerFS returns a Handler that serves the files in fsys. To overlay
+// several sources so that lookups fall through in order (e.g. a user
+// override directory shadowing embedded defaults), combine them with
+// OverlayFS first.
+func FileServerFS(fsys fs.FS, options ...Option) *Handler {
 	option := option{
 		compressibleContentTypes: []string{
 			"application/atom+xml",
@@ -57,6 +198,9 @@ func FileServer(dir string, options ...Option) http.Handler {
 			"text/plain",
 		},
 		compressibleContentLength: 1024,
+		compressionAlgorithms:     []string{"gzip", "deflate", "br", "zstd"},
+		compressionLevels:         map[string]int{},
+		precompressedExtensions:   map[string]string{},
 		notFound:                  http.HandlerFunc(http.NotFound),
 	}
 	for _, fn := range options {
@@ -64,28 +208,54 @@ func FileServer(dir string, options ...Option) http.Handler {
 	}
 
 	contents := map[string]http.Handler{}
+	manifest := map[string]AssetInfo{}
 
-	filepath.Walk(dir, func(fpath string, fi fs.FileInfo, err error) error {
-		relpath, err := filepath.Rel(dir, fpath)
-		if err != nil {
+	// Sidecars (e.g. app.js.gz) are discovered up-front so they can be
+	// skipped as routes of their own and matched back to their primary
+	// file below.
+	sidecars := map[string]map[string]string{} // primary fpath -> algorithm -> sidecar fpath
+	isSidecar := map[string]bool{}
+	fs.WalkDir(fsys, ".", func(fpath string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		for ext, algorithm := range option.precompressedExtensions {
+			if strings.HasSuffix(fpath, ext) {
+				primary := strings.TrimSuffix(fpath, ext)
+				if pfi, err := fs.Stat(fsys, primary); err == nil && !pfi.IsDir() {
+					if sidecars[primary] == nil {
+						sidecars[primary] = map[string]string{}
+					}
+					sidecars[primary][algorithm] = fpath
+					isSidecar[fpath] = true
+				}
+				break
+			}
+		}
+		return nil
+	})
+
+	fs.WalkDir(fsys, ".", func(fpath string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || isSidecar[fpath] {
 			return nil
 		}
 
-		if fi.IsDir() {
+		fi, err := d.Info()
+		if err != nil {
 			return nil
 		}
 
-		upath := path.Join("/", filepath.ToSlash(relpath))
+		upath := path.Join("/", fpath)
 		name := fi.Name()
 		modtime := fi.ModTime()
 
-		body, err := os.ReadFile(fpath)
+		body, err := fs.ReadFile(fsys, fpath)
 		if err != nil {
 			return nil
 		}
 
 		// detect Content-Type
-		contentType := mime.TypeByExtension(filepath.Ext(fpath))
+		contentType := mime.TypeByExtension(path.Ext(fpath))
 		if contentType == "" {
 			if len(body) > 512 {
 				contentType = http.DetectContentType(body[:512])
@@ -94,61 +264,109 @@ func FileServer(dir string, options ...Option) http.Handler {
 			}
 		}
 
-		var handler http.HandlerFunc
-		if len(body) >= option.compressibleContentLength && contentType != "" && sort.SearchStrings(option.compressibleContentTypes, contentType) >= 0 {
-			// compressible Content-Type
-			compressed := map[string][]byte{
-				"gzip": func() []byte {
-					buf := bytes.NewBuffer(nil)
-					gzipWriter, _ := gzip.NewWriterLevel(buf, gzip.BestCompression)
-					io.Copy(gzipWriter, bytes.NewReader(body))
-					gzipWriter.Flush()
-					gzipWriter.Close()
-					return buf.Bytes()
-				}(),
-				"deflate": func() []byte {
-					buf := bytes.NewBuffer(nil)
-					deflateWriter, _ := zlib.NewWriterLevel(buf, zlib.BestCompression)
-					io.Copy(deflateWriter, bytes.NewReader(body))
-					deflateWriter.Flush()
-					deflateWriter.Close()
-					return buf.Bytes()
-				}(),
+		etag := computeETag(body)
+		eligible := len(body) >= option.compressibleContentLength && contentType != "" && sort.SearchStrings(option.compressibleContentTypes, contentType) >= 0
+
+		// compressed holds, per negotiable algorithm, the payload to serve
+		// under the primary's own URL. Only populated when the primary is
+		// compression-eligible.
+		compressed := map[string][]byte{}
+		if eligible {
+			for _, algorithm := range option.compressionAlgorithms {
+				if sidecarPath, ok := sidecars[fpath][algorithm]; ok {
+					if sidecarBody, err := fs.ReadFile(fsys, sidecarPath); err == nil {
+						compressed[algorithm] = sidecarBody
+						continue
+					}
+				}
+
+				level, ok := option.compressionLevels[algorithm]
+				if !ok {
+					level = defaultCompressionLevel(algorithm)
+				}
+				if data, ok := compress(algorithm, level, body); ok {
+					compressed[algorithm] = data
+				}
 			}
+		}
 
+		var encodings []string
+		for algorithm := range compressed {
+			encodings = append(encodings, algorithm)
+		}
+		sort.Strings(encodings)
+
+		var handler http.HandlerFunc
+		if len(compressed) > 0 {
 			handler = func(w http.ResponseWriter, r *http.Request) {
 				algorithm := ""
-				if r.Header.Get("Range") == "" {
-					for _, acceptedEncoding := range ParseAcceptEncoding(r.Header.Values("Accept-Encoding")...) {
-						if _, ok := compressed[acceptedEncoding.Algorithm]; ok {
-							algorithm = acceptedEncoding.Algorithm
-							break
-						}
+				for _, acceptedEncoding := range ParseAcceptEncoding(r.Header.Values("Accept-Encoding")...) {
+					if _, ok := compressed[acceptedEncoding.Algorithm]; ok {
+						algorithm = acceptedEncoding.Algorithm
+						break
 					}
 				}
 
 				if algorithm != "" {
-					w.Header().Set("Accept-Ranges", "bytes")
-					w.Header().Set("Last-Modified", modtime.UTC().Format(http.TimeFormat))
+					// The payload is already a fully materialized []byte, so
+					// http.ServeContent can range over it directly once
+					// Content-Encoding is set; this gives us Range/If-Range
+					// and conditional-request handling for free.
+					w.Header().Set("ETag", encodingETag(etag, algorithm))
 					w.Header().Set("Content-Encoding", algorithm)
 					w.Header().Set("Content-Type", contentType)
-					w.WriteHeader(http.StatusOK)
-					if r.Method != http.MethodHead {
-						body := compressed[algorithm]
-						io.CopyN(w, bytes.NewReader(body), int64(len(body)))
-					}
+					http.ServeContent(w, r, name, modtime, bytes.NewReader(compressed[algorithm]))
 				} else {
+					w.Header().Set("ETag", etag)
 					w.Header().Set("Content-Type", contentType)
 					http.ServeContent(w, r, name, modtime, bytes.NewReader(body))
 				}
 			}
 		} else {
 			handler = func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("ETag", etag)
 				w.Header().Set("Content-Type", contentType)
 				http.ServeContent(w, r, name, modtime, bytes.NewReader(body))
 			}
 		}
 
+		// Any sidecar whose algorithm didn't make it into compressed above
+		// (primary ineligible, or the algorithm excluded via
+		// WithCompressionAlgorithms) would otherwise be unreachable dead
+		// weight on disk. Cache its bytes once and register it as its own
+		// route instead.
+		for algorithm, sidecarPath := range sidecars[fpath] {
+			if _, ok := compressed[algorithm]; ok {
+				continue
+			}
+
+			sidecarBody, err := fs.ReadFile(fsys, sidecarPath)
+			if err != nil {
+				continue
+			}
+
+			algorithm, sidecarPath, sidecarBody := algorithm, sidecarPath, sidecarBody
+			sidecarETag := encodingETag(etag, algorithm)
+			contents[path.Join("/", sidecarPath)] = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("ETag", sidecarETag)
+				w.Header().Set("Content-Encoding", algorithm)
+				w.Header().Set("Content-Type", contentType)
+				http.ServeContent(w, r, path.Base(sidecarPath), modtime, bytes.NewReader(sidecarBody))
+			})
+		}
+
+		manifest[upath] = AssetInfo{
+			Path:        upath,
+			Size:        int64(len(body)),
+			ContentType: contentType,
+			ModTime:     modtime,
+			SRI: map[string]string{
+				"sha256": sriHash("sha256", body),
+				"sha384": sriHash("sha384", body),
+			},
+			Encodings: encodings,
+		}
+
 		if dir, filename := path.Split(upath); filename == "index.html" {
 			if dir != "/" && strings.HasSuffix(dir, "/") {
 				dir = strings.TrimSuffix(dir, "/")
@@ -169,21 +387,28 @@ func FileServer(dir string, options ...Option) http.Handler {
 		return nil
 	})
 
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		upath := r.URL.Path
-		if !strings.HasPrefix(upath, "/") {
-			upath = "/" + upath
-			r.URL.Path = upath
-		}
-		upath = path.Clean(upath)
+	if option.manifestEndpoint != "" {
+		contents[option.manifestEndpoint] = manifestHandler(manifest)
+	}
 
-		next, ok := contents[upath]
-		if !ok {
-			option.notFound.ServeHTTP(w, r)
-			return
-		}
+	return &Handler{
+		manifest: manifest,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			upath := r.URL.Path
+			if !strings.HasPrefix(upath, "/") {
+				upath = "/" + upath
+				r.URL.Path = upath
+			}
+			upath = path.Clean(upath)
 
-		w.Header().Add("Vary", "Accept-Encoding")
-		next.ServeHTTP(w, r)
-	})
+			next, ok := contents[upath]
+			if !ok {
+				option.notFound.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Accept-Encoding")
+			next.ServeHTTP(w, r)
+		}),
+	}
 }
@@ -0,0 +1,115 @@
+package statics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/thamaji/statics"
+)
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSidecarNegotiation(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "app.js", strings.Repeat("x", 2048))
+	writeFile(t, dir, "app.js.gz", "precompressed-gzip-bytes")
+
+	h := statics.FileServer(dir, statics.WithPrecompressedExtensions(map[string]string{".gz": "gzip"}))
+
+	req := httptest.NewRequest(http.MethodGet, "/app.js", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+	if w.Body.String() != "precompressed-gzip-bytes" {
+		t.Fatalf("body = %q, want sidecar content", w.Body.String())
+	}
+	if w.Header().Get("ETag") == "" {
+		t.Fatal("ETag not set")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/app.js.gz", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("sidecar should not be routable on its own path, status = %d", w.Code)
+	}
+}
+
+func TestSidecarOrphanedByIneligiblePrimary(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "app.bin", "tiny") // below compressibleContentLength and not a compressible Content-Type
+	writeFile(t, dir, "app.bin.gz", "precompressed-gzip-bytes")
+
+	h := statics.FileServer(dir, statics.WithPrecompressedExtensions(map[string]string{".gz": "gzip"}))
+
+	req := httptest.NewRequest(http.MethodGet, "/app.bin.gz", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+	if w.Body.String() != "precompressed-gzip-bytes" {
+		t.Fatalf("body = %q, want sidecar content", w.Body.String())
+	}
+	if w.Header().Get("ETag") == "" {
+		t.Fatal("ETag not set")
+	}
+}
+
+func TestSidecarExcludedAlgorithm(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "app.js", strings.Repeat("x", 2048))
+	writeFile(t, dir, "app.js.br", "precompressed-brotli-bytes")
+
+	h := statics.FileServer(dir,
+		statics.WithPrecompressedExtensions(map[string]string{".br": "br"}),
+		statics.WithCompressionAlgorithms([]string{"gzip"}),
+	)
+
+	// br is excluded from the negotiated algorithms, so it must never be
+	// offered for the primary...
+	req := httptest.NewRequest(http.MethodGet, "/app.js", nil)
+	req.Header.Set("Accept-Encoding", "br")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if got := w.Header().Get("Content-Encoding"); got == "br" {
+		t.Fatalf("excluded algorithm br was negotiated for /app.js")
+	}
+
+	// ...but the sidecar on disk must still be reachable at its own path.
+	req = httptest.NewRequest(http.MethodGet, "/app.js.br", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if got := w.Header().Get("Content-Encoding"); got != "br" {
+		t.Fatalf("Content-Encoding = %q, want br", got)
+	}
+	if w.Body.String() != "precompressed-brotli-bytes" {
+		t.Fatalf("body = %q, want sidecar content", w.Body.String())
+	}
+	if w.Header().Get("ETag") == "" {
+		t.Fatal("ETag not set")
+	}
+}